@@ -5,13 +5,22 @@
 package golang
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	"golang.org/x/tools/gopls/internal/cache"
 	"golang.org/x/tools/gopls/internal/cache/metadata"
@@ -22,14 +31,34 @@ import (
 // CompilerOptDetails invokes the Go compiler with the "-json=0,dir"
 // flag on the specified package, parses its log of optimization
 // decisions, and returns them as a set of diagnostics.
-func CompilerOptDetails(ctx context.Context, snapshot *cache.Snapshot, mp *metadata.Package) (map[protocol.DocumentURI][]*cache.Diagnostic, error) {
+//
+// If mp's directory contains any _test.go (or _xtest) sources, "go
+// build" cannot produce a binary for it, so CompilerOptDetails instead
+// links it with "go test -c"; the returned bool reports whether the
+// diagnostics came from that test binary rather than mp's ordinary
+// build, so a caller combining results from several packages can
+// present the two separately.
+//
+// pgoProfile, if non-empty, is passed to the compiler as "-pgo=" so the
+// reported decisions reflect profile-guided inlining and
+// devirtualization; pass a workspace-configured profile to override the
+// one the package would otherwise pick up. If empty, CompilerOptDetails
+// falls back to mp's own default.pgo, if any, so profile-guided
+// decisions are still reported without the caller needing to resolve
+// the path itself.
+func CompilerOptDetails(ctx context.Context, snapshot *cache.Snapshot, mp *metadata.Package, pgoProfile string) (map[protocol.DocumentURI][]*cache.Diagnostic, bool, error) {
 	if len(mp.CompiledGoFiles) == 0 {
-		return nil, nil
+		return nil, false, nil
 	}
 	pkgDir := mp.CompiledGoFiles[0].DirPath()
+	testBinary := hasTestFiles(pkgDir)
+	if pgoProfile == "" {
+		pgoProfile = DefaultPGOProfile(pkgDir)
+	}
+
 	outDir, err := os.MkdirTemp("", fmt.Sprintf("gopls-%d.details", os.Getpid()))
 	if err != nil {
-		return nil, err
+		return nil, testBinary, err
 	}
 	defer func() {
 		if err := os.RemoveAll(outDir); err != nil {
@@ -39,7 +68,7 @@ func CompilerOptDetails(ctx context.Context, snapshot *cache.Snapshot, mp *metad
 
 	tmpFile, err := os.CreateTemp(os.TempDir(), "gopls-x")
 	if err != nil {
-		return nil, err
+		return nil, testBinary, err
 	}
 	tmpFile.Close() // ignore error
 	defer os.Remove(tmpFile.Name())
@@ -50,22 +79,35 @@ func CompilerOptDetails(ctx context.Context, snapshot *cache.Snapshot, mp *metad
 	if !strings.HasPrefix(outDir, "/") {
 		outDirURI = protocol.DocumentURI(strings.Replace(string(outDirURI), "file:///", "file://", 1))
 	}
-	inv, cleanupInvocation, err := snapshot.GoCommandInvocation(cache.NoNetwork, pkgDir, "build", []string{
-		fmt.Sprintf("-gcflags=-json=0,%s", outDirURI), // JSON schema version 0
-		fmt.Sprintf("-o=%s", tmpFile.Name()),
-		".",
-	})
+	gcflags := fmt.Sprintf("-gcflags=-json=0,%s", outDirURI) // JSON schema version 0
+
+	verb := "build"
+	args := []string{gcflags, fmt.Sprintf("-o=%s", tmpFile.Name())}
+	if testBinary {
+		// "go build" cannot compile a package's _test.go or _xtest
+		// sources; link the test binary instead, discarding it, so the
+		// compiler still runs over those files and logs its decisions.
+		// -vet=off: we only want the compiler's optimization log, not a
+		// vet failure aborting the link before it produces one.
+		verb = "test"
+		args = []string{"-c", "-vet=off", gcflags, fmt.Sprintf("-o=%s", tmpFile.Name())}
+	}
+	if pgoProfile != "" {
+		args = append(args, fmt.Sprintf("-pgo=%s", pgoProfile))
+	}
+	args = append(args, ".")
+	inv, cleanupInvocation, err := snapshot.GoCommandInvocation(cache.NoNetwork, pkgDir, verb, args)
 	if err != nil {
-		return nil, err
+		return nil, testBinary, err
 	}
 	defer cleanupInvocation()
 	_, err = snapshot.View().GoCommandRunner().Run(ctx, *inv)
 	if err != nil {
-		return nil, err
+		return nil, testBinary, err
 	}
 	files, err := findJSONFiles(outDir)
 	if err != nil {
-		return nil, err
+		return nil, testBinary, err
 	}
 	reports := make(map[protocol.DocumentURI][]*cache.Diagnostic)
 	var parseError error
@@ -87,7 +129,47 @@ func CompilerOptDetails(ctx context.Context, snapshot *cache.Snapshot, mp *metad
 		}
 		reports[fh.URI()] = diagnostics
 	}
-	return reports, parseError
+	return reports, testBinary, parseError
+}
+
+// hasTestFiles reports whether pkgDir contains any _test.go sources,
+// which "go build" cannot link into a binary on its own. mp.CompiledGoFiles
+// is not a reliable source for this: for the ordinary package variant,
+// go/packages excludes _test.go files entirely, so they only ever show
+// up in a separate test-variant *metadata.Package (e.g. "p [p.test]")
+// that CompilerOptDetails is not necessarily handed.
+func hasTestFiles(pkgDir string) bool {
+	entries, err := os.ReadDir(pkgDir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), "_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultPGOProfile returns the path to a "default.pgo" file in pkgDir,
+// or "" if there is none.
+//
+// For the ordinary "go build" path, the go command already applies this
+// profile on its own whenever -pgo is left unset, so CompilerOptDetails
+// passing it explicitly through -pgo= is redundant there, mattering only
+// so the resolved path can be reported alongside the diagnostics. But
+// for the "go test -c" path taken when hasTestFiles is true, auto-apply
+// does not hold: the profile sits in the package directory, not the
+// synthesized test main's, so the go command has no default.pgo of its
+// own to find. There, passing -pgo= explicitly is what makes
+// profile-guided decisions show up in the test binary's build at all,
+// not just a reporting nicety.
+func DefaultPGOProfile(pkgDir string) string {
+	profile := filepath.Join(pkgDir, "default.pgo")
+	if _, err := os.Stat(profile); err != nil {
+		return ""
+	}
+	return profile
 }
 
 // parseDetailsFile parses the file written by the Go compiler which contains a JSON-encoded protocol.Diagnostic.
@@ -204,3 +286,376 @@ func findJSONFiles(dir string) ([]string, error) {
 	err := filepath.Walk(dir, f)
 	return ans, err
 }
+
+// A CompilerOptCategory classifies a single optimization decision
+// emitted by the compiler's "-m=2" debug output, so that clients can
+// filter or render each kind independently (e.g. as distinct inlay
+// hints) instead of treating them as one undifferentiated diagnostic
+// stream, as CompilerOptDetails does.
+type CompilerOptCategory string
+
+const (
+	CategoryEscape       CompilerOptCategory = "escape"
+	CategoryLeak         CompilerOptCategory = "leak"
+	CategoryInline       CompilerOptCategory = "inline"
+	CategoryBoundsCheck  CompilerOptCategory = "bounds-check"
+	CategoryNilCheck     CompilerOptCategory = "nilcheck"
+	CategoryLoopModified CompilerOptCategory = "loop-modified"
+)
+
+// A CompilerOptDetail is a single per-variable or per-callsite
+// optimization decision parsed from the compiler's "-m=2" output,
+// positioned at the token it concerns.
+type CompilerOptDetail struct {
+	Category CompilerOptCategory
+	URI      protocol.DocumentURI
+	Range    protocol.Range
+	Message  string // the compiler's own text, e.g. "b escapes to heap", "inlining call to small"
+}
+
+// optLineRE matches one line of "go build -gcflags=-m=2" output, e.g.
+//
+//	./foo.go:12:6: b escapes to heap
+//	./foo.go:20:2: inlining call to small
+var optLineRE = regexp.MustCompile(`^(.+\.go):(\d+):(\d+): (.+)$`)
+
+// classifyOptMessage maps a "-m=2" message to the category of
+// optimization decision it reports. The message prefixes recognized
+// here were gathered by grepping the source of cmd/compile for the
+// literal strings it logs; like the prefixes in parseDetailsFile, the
+// set is not well defined, so unrecognized messages are dropped rather
+// than misfiled.
+func classifyOptMessage(msg string) (CompilerOptCategory, bool) {
+	switch {
+	case strings.Contains(msg, "escapes to heap"),
+		strings.Contains(msg, "does not escape"),
+		strings.Contains(msg, "moved to heap"):
+		return CategoryEscape, true
+	case strings.Contains(msg, "leaking param"):
+		return CategoryLeak, true
+	case strings.Contains(msg, "inlining call to"),
+		strings.Contains(msg, "can inline"),
+		strings.Contains(msg, "cannot inline"):
+		return CategoryInline, true
+	case strings.Contains(msg, "bounds check"):
+		return CategoryBoundsCheck, true
+	case strings.Contains(msg, "nil check"):
+		return CategoryNilCheck, true
+	case strings.Contains(msg, "loop-modified"),
+		strings.Contains(msg, "now per-iteration"):
+		return CategoryLoopModified, true
+	}
+	return "", false
+}
+
+// utf16Column converts col, the compiler's 1-based UTF-8 byte column on
+// the line'th (1-based) line of lines, to a 0-based UTF-16 column
+// suitable for an LSP Position.Character. lines or the requested line
+// may be missing (e.g. if the file couldn't be read), in which case col
+// is returned unconverted, on the assumption that an ASCII-only line is
+// the common case so an uncorrected byte column is usually still right.
+func utf16Column(lines [][]byte, line, col int) int {
+	if line-1 < 0 || line-1 >= len(lines) || col-1 < 0 {
+		return col - 1
+	}
+	l := bytes.TrimSuffix(lines[line-1], []byte("\r"))
+	if col-1 > len(l) {
+		return col - 1
+	}
+	return protocol.UTF16Len(l[:col-1])
+}
+
+// verboseDetailsCacheSize bounds the number of packages'
+// CompilerOptVerboseDetails results kept in verboseDetailsCache, so a
+// long editing session doesn't grow it without limit.
+const verboseDetailsCacheSize = 32
+
+// verboseDetailsCache memoizes CompilerOptVerboseDetails results keyed
+// by the hash of the package's compiled source files (as seen by the
+// snapshot, so unsaved overlay edits are accounted for), so that
+// toggling the overlay on and off repeatedly in an editing session does
+// not trigger a full rebuild each time the content hasn't changed. It
+// evicts the oldest entry once verboseDetailsCacheSize is exceeded.
+var verboseDetailsCache = &lruDetailsCache{
+	entries: make(map[string]map[CompilerOptCategory][]*CompilerOptDetail),
+}
+
+type lruDetailsCache struct {
+	mu      sync.Mutex
+	order   []string // insertion order, oldest first
+	entries map[string]map[CompilerOptCategory][]*CompilerOptDetail
+}
+
+func (c *lruDetailsCache) get(key string) (map[CompilerOptCategory][]*CompilerOptDetail, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[key]
+	return v, ok
+}
+
+func (c *lruDetailsCache) put(key string, v map[CompilerOptCategory][]*CompilerOptDetail) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = v
+	for len(c.order) > verboseDetailsCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// packageSourceHash returns a content hash of mp's compiled Go files as
+// currently seen by snapshot, suitable as a cache key: it changes
+// whenever one of mp's compiled Go files changes, including an open
+// file's unsaved overlay edits (which is what the compiler invocation
+// below actually reads, via snapshot.GoCommandInvocation). Other inputs
+// to the build, such as mp's dependencies, are not part of the hash.
+func packageSourceHash(snapshot *cache.Snapshot, mp *metadata.Package) (string, error) {
+	h := sha256.New()
+	for _, uri := range mp.CompiledGoFiles {
+		fh := snapshot.FindFile(uri)
+		if fh == nil {
+			return "", fmt.Errorf("no file handle for %s", uri)
+		}
+		fmt.Fprintln(h, fh.Identity())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CompilerOptVerboseDetails invokes the Go compiler with the
+// "-gcflags=-m=2" flag on the specified package, in addition to the
+// "-json=0,dir" diagnostics already gathered by CompilerOptDetails,
+// parses its textual log of escape analysis, inlining, and
+// bounds/nil-check decisions, and returns them split by
+// CompilerOptCategory so that a client can show, say, only escape
+// decisions as inlay hints without wading through everything else the
+// compiler logged. Each detail's Range is already converted from the
+// compiler's 1-based UTF-8 byte column to a 0-based UTF-16 column, so
+// callers (e.g. CompilerOptInlayHints) can use it directly as an LSP
+// position.
+func CompilerOptVerboseDetails(ctx context.Context, snapshot *cache.Snapshot, mp *metadata.Package) (map[CompilerOptCategory][]*CompilerOptDetail, error) {
+	if len(mp.CompiledGoFiles) == 0 {
+		return nil, nil
+	}
+	key, err := packageSourceHash(snapshot, mp)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := verboseDetailsCache.get(key); ok {
+		return cached, nil
+	}
+
+	pkgDir := mp.CompiledGoFiles[0].DirPath()
+	tmpFile, err := os.CreateTemp(os.TempDir(), "gopls-m2")
+	if err != nil {
+		return nil, err
+	}
+	tmpFile.Close() // ignore error
+	defer os.Remove(tmpFile.Name())
+
+	inv, cleanupInvocation, err := snapshot.GoCommandInvocation(cache.NoNetwork, pkgDir, "build", []string{
+		"-gcflags=-m=2",
+		fmt.Sprintf("-o=%s", tmpFile.Name()),
+		".",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupInvocation()
+	_, stderr, err, _ := snapshot.View().GoCommandRunner().RunRaw(ctx, *inv)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[CompilerOptCategory][]*CompilerOptDetail)
+	fileLines := make(map[string][][]byte) // abs path -> content split into lines, filled lazily
+	sc := bufio.NewScanner(stderr)
+	for sc.Scan() {
+		m := optLineRE.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		category, ok := classifyOptMessage(m[4])
+		if !ok {
+			continue
+		}
+		line, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		col, err := strconv.Atoi(m[3])
+		if err != nil {
+			continue
+		}
+		abs := m[1]
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(pkgDir, abs)
+		}
+		lines, ok := fileLines[abs]
+		if !ok {
+			if fh := snapshot.FindFile(protocol.URIFromPath(abs)); fh != nil {
+				if content, err := fh.Content(); err == nil {
+					lines = bytes.Split(content, []byte("\n"))
+				}
+			}
+			fileLines[abs] = lines
+		}
+		pos := protocol.Position{Line: uint32(line - 1), Character: uint32(utf16Column(lines, line, col))}
+		detail := &CompilerOptDetail{
+			Category: category,
+			URI:      protocol.URIFromPath(abs),
+			Range:    protocol.Range{Start: pos, End: pos},
+			Message:  m[4],
+		}
+		results[category] = append(results[category], detail)
+	}
+
+	verboseDetailsCache.put(key, results)
+	return results, nil
+}
+
+// compilerOptHintLabel returns the short marker text rendered as an
+// inlay hint for a single optimization decision, e.g. "escapes to
+// heap", "inlined", or "bce" for an elided bounds check.
+func compilerOptHintLabel(d *CompilerOptDetail) string {
+	switch d.Category {
+	case CategoryEscape:
+		if strings.Contains(d.Message, "does not escape") {
+			return "stack"
+		}
+		return "escapes to heap"
+	case CategoryInline:
+		if strings.Contains(d.Message, "inlining call to") {
+			return "inlined"
+		}
+		return "not inlined"
+	case CategoryBoundsCheck:
+		return "bce"
+	case CategoryNilCheck:
+		return "nilcheck"
+	case CategoryLeak:
+		return "leaks"
+	case CategoryLoopModified:
+		return "per-iteration"
+	}
+	return string(d.Category)
+}
+
+// CompilerOptInlayHints renders details, a single file's worth of
+// results from CompilerOptVerboseDetails, as LSP inlay hints positioned
+// at the end of each detail's Range, which is the empty range at the
+// column the compiler reported for the decision (the start of the token
+// it concerns).
+func CompilerOptInlayHints(details []*CompilerOptDetail) []protocol.InlayHint {
+	var hints []protocol.InlayHint
+	for _, d := range details {
+		hints = append(hints, protocol.InlayHint{
+			Position: d.Range.End,
+			Label: []protocol.InlayHintLabelPart{
+				{Value: " " + compilerOptHintLabel(d)},
+			},
+			Kind:        protocol.Type,
+			PaddingLeft: true,
+			Tooltip: &protocol.Or_InlayHint_tooltip{
+				Value: d.Message,
+			},
+		})
+	}
+	return hints
+}
+
+// CompilerOptCodeLenses returns one code lens per top-level function
+// declaration in file, offering to toggle the compiler-optimization
+// overlay (escape/inline/bounds-check hints) for that function's file.
+// enabled reflects whether the overlay is currently showing for uri, so
+// the lens title can read "Show" or "Hide" accordingly. Positions are
+// taken from fset, the FileSet that parsed file; callers are expected to
+// convert the resulting zero-indexed UTF-8 columns to UTF-16 as usual
+// when the client doesn't support UTF-8 positions.
+func CompilerOptCodeLenses(fset *token.FileSet, file *ast.File, uri protocol.DocumentURI, enabled bool) []protocol.CodeLens {
+	title := "Show compiler optimization details"
+	if enabled {
+		title = "Hide compiler optimization details"
+	}
+	var lenses []protocol.CodeLens
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		start := fset.Position(fn.Pos())
+		end := fset.Position(fn.End())
+		rng := protocol.Range{
+			Start: protocol.Position{Line: uint32(start.Line - 1), Character: uint32(start.Column - 1)},
+			End:   protocol.Position{Line: uint32(end.Line - 1), Character: uint32(end.Column - 1)},
+		}
+		lenses = append(lenses, protocol.CodeLens{
+			Range: rng,
+			Command: &protocol.Command{
+				Title:     title,
+				Command:   "gopls.toggle_gc_details",
+				Arguments: []json.RawMessage{encodeURIArg(uri)},
+			},
+		})
+	}
+	return lenses
+}
+
+// CompilerOptInlayHint returns the inlay hints for uri's categories
+// enabled in want, computed from mp's CompilerOptVerboseDetails. It is
+// the entry point a hint provider calls per file, rather than calling
+// CompilerOptVerboseDetails (which reports every file in the package)
+// and CompilerOptInlayHints directly.
+func CompilerOptInlayHint(ctx context.Context, snapshot *cache.Snapshot, mp *metadata.Package, uri protocol.DocumentURI, want map[CompilerOptCategory]bool) ([]protocol.InlayHint, error) {
+	all, err := CompilerOptVerboseDetails(ctx, snapshot, mp)
+	if err != nil {
+		return nil, err
+	}
+	var details []*CompilerOptDetail
+	for category, ds := range all {
+		if !want[category] {
+			continue
+		}
+		for _, d := range ds {
+			if d.URI == uri {
+				details = append(details, d)
+			}
+		}
+	}
+	return CompilerOptInlayHints(details), nil
+}
+
+// CompilerOptCodeLens returns the code lenses offering to toggle the
+// compiler-optimization overlay for each top-level function declared in
+// uri, as currently seen by snapshot. enabled reflects whether the
+// overlay is currently showing for uri.
+func CompilerOptCodeLens(ctx context.Context, snapshot *cache.Snapshot, uri protocol.DocumentURI, enabled bool) ([]protocol.CodeLens, error) {
+	fh := snapshot.FindFile(uri)
+	if fh == nil {
+		return nil, fmt.Errorf("no file handle for %s", uri)
+	}
+	content, err := fh.Content()
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, uri.Path(), content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	return CompilerOptCodeLenses(fset, file, uri, enabled), nil
+}
+
+// encodeURIArg marshals uri for inclusion in a protocol.Command's
+// Arguments, matching the convention used by gopls's other
+// "gopls.toggle_gc_details"-style commands.
+func encodeURIArg(uri protocol.DocumentURI) json.RawMessage {
+	b, err := json.Marshal(uri)
+	if err != nil {
+		// protocol.DocumentURI always marshals successfully.
+		panic(err)
+	}
+	return b
+}
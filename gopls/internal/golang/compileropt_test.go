@@ -0,0 +1,127 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHasTestFiles(t *testing.T) {
+	dir := t.TempDir()
+	if hasTestFiles(dir) {
+		t.Errorf("hasTestFiles(%s) = true for an empty directory", dir)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "foo.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if hasTestFiles(dir) {
+		t.Errorf("hasTestFiles(%s) = true with only a non-test source file", dir)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "foo_test.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !hasTestFiles(dir) {
+		t.Errorf("hasTestFiles(%s) = false with a _test.go file present", dir)
+	}
+
+	if hasTestFiles(filepath.Join(dir, "does-not-exist")) {
+		t.Errorf("hasTestFiles of a nonexistent directory = true, want false")
+	}
+}
+
+func TestDefaultPGOProfile(t *testing.T) {
+	dir := t.TempDir()
+	if got := DefaultPGOProfile(dir); got != "" {
+		t.Errorf("DefaultPGOProfile(%s) = %q, want \"\" with no default.pgo", dir, got)
+	}
+
+	profile := filepath.Join(dir, "default.pgo")
+	if err := os.WriteFile(profile, []byte("not a real profile"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := DefaultPGOProfile(dir); got != profile {
+		t.Errorf("DefaultPGOProfile(%s) = %q, want %q", dir, got, profile)
+	}
+}
+
+func TestClassifyOptMessage(t *testing.T) {
+	for _, test := range []struct {
+		msg  string
+		want CompilerOptCategory
+		ok   bool
+	}{
+		{"b escapes to heap", CategoryEscape, true},
+		{"a does not escape", CategoryEscape, true},
+		{"moved to heap: x", CategoryEscape, true},
+		{"leaking param: p", CategoryLeak, true},
+		{"inlining call to small", CategoryInline, true},
+		{"can inline f", CategoryInline, true},
+		{"cannot inline f: recursive", CategoryInline, true},
+		{"index bounds check elided", CategoryBoundsCheck, true},
+		{"nil check elided", CategoryNilCheck, true},
+		{"loop-modified-range", CategoryLoopModified, true},
+		{"now per-iteration", CategoryLoopModified, true},
+		{"some unrelated message", "", false},
+	} {
+		got, ok := classifyOptMessage(test.msg)
+		if got != test.want || ok != test.ok {
+			t.Errorf("classifyOptMessage(%q) = (%q, %v), want (%q, %v)", test.msg, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestCompilerOptHintLabel(t *testing.T) {
+	for _, test := range []struct {
+		d    *CompilerOptDetail
+		want string
+	}{
+		{&CompilerOptDetail{Category: CategoryEscape, Message: "x does not escape"}, "stack"},
+		{&CompilerOptDetail{Category: CategoryEscape, Message: "x escapes to heap"}, "escapes to heap"},
+		{&CompilerOptDetail{Category: CategoryInline, Message: "inlining call to f"}, "inlined"},
+		{&CompilerOptDetail{Category: CategoryInline, Message: "cannot inline f"}, "not inlined"},
+		{&CompilerOptDetail{Category: CategoryBoundsCheck}, "bce"},
+		{&CompilerOptDetail{Category: CategoryNilCheck}, "nilcheck"},
+		{&CompilerOptDetail{Category: CategoryLeak}, "leaks"},
+		// CategoryLoopModified covers a loop variable given a fresh
+		// per-iteration copy (as of Go 1.22), not a heap allocation.
+		{&CompilerOptDetail{Category: CategoryLoopModified}, "per-iteration"},
+	} {
+		if got := compilerOptHintLabel(test.d); got != test.want {
+			t.Errorf("compilerOptHintLabel(%+v) = %q, want %q", test.d, got, test.want)
+		}
+	}
+}
+
+func TestUTF16Column(t *testing.T) {
+	// var s = "héllo" - 'é' (bytes 11-12) is a 2-byte UTF-8 sequence but
+	// a single UTF-16 code unit, so any column past it should trail the
+	// UTF-8 byte column by 1.
+	lines := [][]byte{[]byte(`var s = "héllo"`)}
+	for _, test := range []struct {
+		col  int
+		want int
+	}{
+		{1, 0},
+		{9, 8},   // just before the opening quote: no multi-byte runes yet
+		{11, 10}, // just before 'é': still all ASCII so far
+		{13, 11}, // just past 'é': UTF-16 column trails the UTF-8 byte column by 1
+	} {
+		if got := utf16Column(lines, 1, test.col); got != test.want {
+			t.Errorf("utf16Column(lines, 1, %d) = %d, want %d", test.col, got, test.want)
+		}
+	}
+
+	// Missing line/file data falls back to the uncorrected byte column.
+	if got := utf16Column(nil, 1, 5); got != 4 {
+		t.Errorf("utf16Column(nil, 1, 5) = %d, want 4", got)
+	}
+	if got := utf16Column(lines, 5, 1); got != 0 {
+		t.Errorf("utf16Column(lines, 5, 1) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	pathpkg "path"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/gopls/internal/golang/stubmethods"
+)
+
+// StubMethods returns the text of file, with stub implementations of
+// every method of si.Iface that si.Concrete does not already implement
+// declared after si.Concrete's own declaration. file and src are the
+// syntax and source text of the file enclosing the fix.
+//
+// Imports that the stubbed methods require are resolved against file's
+// own import list, adding one if needed, rather than against the
+// interface's declaring package: for an anonymous interface literal
+// (si.Interface nil, si.IfaceNode set) there is no declaring package to
+// consult at all, and GetStubInfo gives us no other file to consult for
+// a named one either, so both cases are handled the same way here.
+func StubMethods(fset *token.FileSet, file *ast.File, src []byte, si *stubmethods.StubInfo) ([]byte, error) {
+	missing := missingMethods(si)
+	if len(missing) == 0 {
+		return nil, fmt.Errorf("%s already implements the requested interface", si.Concrete.Obj().Name())
+	}
+
+	var newImports []newImport
+	fileQual := importQualifier(file, &newImports)
+	qual := func(pkg *types.Package) string {
+		if pkg.Path() == si.Concrete.Obj().Pkg().Path() {
+			return "" // the file's own package, which needs no import
+		}
+		return fileQual(pkg)
+	}
+
+	recv := stubReceiver(si.Concrete.Obj().Name())
+	var decls bytes.Buffer
+	for _, m := range missing {
+		decls.WriteByte('\n')
+		decls.WriteString(methodStub(recv, si, m, qual))
+	}
+
+	insertOffset := fset.Position(file.End()).Offset
+	if end, ok := concreteDeclEnd(file, si.Concrete); ok {
+		insertOffset = fset.Position(end).Offset
+	}
+
+	var out bytes.Buffer
+	out.Write(src[:insertOffset])
+	out.WriteByte('\n')
+	out.Write(decls.Bytes())
+	out.Write(src[insertOffset:])
+
+	// Re-parse so the new imports can be spliced in as syntax, then
+	// format, rather than trying to patch the import block as text.
+	newFset := token.NewFileSet()
+	filename := fset.Position(file.Package).Filename
+	newFile, err := parser.ParseFile(newFset, filename, out.Bytes(), parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("reparsing file with stubbed methods: %w", err)
+	}
+	for _, imp := range newImports {
+		astutil.AddNamedImport(newFset, newFile, stubImportName(imp), imp.path)
+	}
+	var formatted bytes.Buffer
+	if err := format.Node(&formatted, newFset, newFile); err != nil {
+		return nil, fmt.Errorf("formatting file with stubbed methods: %w", err)
+	}
+	return formatted.Bytes(), nil
+}
+
+// missingMethods returns the methods of si.Iface that si.Concrete (or
+// *si.Concrete, per si.Pointer) does not already implement.
+func missingMethods(si *stubmethods.StubInfo) []*types.Func {
+	concreteType := types.Type(si.Concrete)
+	if si.Pointer {
+		concreteType = types.NewPointer(si.Concrete)
+	}
+	mset := types.NewMethodSet(concreteType)
+	var missing []*types.Func
+	for i := 0; i < si.Iface.NumMethods(); i++ {
+		m := si.Iface.Method(i)
+		if mset.Lookup(m.Pkg(), m.Name()) == nil {
+			missing = append(missing, m)
+		}
+	}
+	return missing
+}
+
+// concreteDeclEnd returns the end position of concrete's own type
+// declaration in file, if file declares it (which it usually does,
+// since the fix is normally offered within the same file as the value
+// being stubbed), and whether it was found. The end returned is that of
+// the enclosing *ast.GenDecl, not just the *ast.TypeSpec, so that on a
+// "type ( ... )" group the new methods land after the closing paren
+// rather than in the middle of the group.
+func concreteDeclEnd(file *ast.File, concrete *types.Named) (token.Pos, bool) {
+	name := concrete.Obj().Name()
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == name {
+				return gd.End(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// stubReceiver picks a short receiver name for a stubbed method: the
+// lowercased first letter of typeName, matching the convention used
+// throughout this codebase's own receivers.
+func stubReceiver(typeName string) string {
+	for _, r := range typeName {
+		return strings.ToLower(string(r))
+	}
+	return "r"
+}
+
+// methodStub renders m, a method of si.Iface, as a stub declaration on
+// si.Concrete with receiver name recv, substituting si.Concrete (or
+// *si.Concrete, per si.Pointer) for any occurrence of si.TypeParam in
+// m's signature (see StubInfo.TypeParam)
+// and qualifying referenced packages with qual. If si.IfaceNode carries
+// m's declaration (an anonymous interface literal), m's doc comment is
+// copied onto the stub.
+func methodStub(recv string, si *stubmethods.StubInfo, m *types.Func, qual types.Qualifier) string {
+	sig := m.Type().(*types.Signature)
+	if si.TypeParam != nil {
+		repl := types.Type(si.Concrete)
+		if si.Pointer {
+			repl = types.NewPointer(si.Concrete)
+		}
+		sig = substType(sig, si.TypeParam, repl).(*types.Signature)
+	}
+
+	recvType := si.Concrete.Obj().Name()
+	if si.Pointer {
+		recvType = "*" + recvType
+	}
+	sigText := strings.TrimPrefix(types.TypeString(sig, qual), "func")
+
+	var buf strings.Builder
+	if doc := methodDoc(si.IfaceNode, m.Name()); doc != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(doc, "\n"), "\n") {
+			fmt.Fprintf(&buf, "// %s\n", line)
+		}
+	}
+	fmt.Fprintf(&buf, "func (%s %s) %s%s {\n\tpanic(\"unimplemented\")\n}\n", recv, recvType, m.Name(), sigText)
+	return buf.String()
+}
+
+// methodDoc returns the doc comment attached to the method named name
+// within ifaceNode, or "" if ifaceNode is nil (a named interface, which
+// StubInfo gives us no declaring file to search for a comment) or has no
+// such method or comment.
+func methodDoc(ifaceNode *ast.InterfaceType, name string) string {
+	if ifaceNode == nil {
+		return ""
+	}
+	for _, f := range ifaceNode.Methods.List {
+		for _, n := range f.Names {
+			if n.Name == name {
+				if f.Doc == nil {
+					return ""
+				}
+				return f.Doc.Text()
+			}
+		}
+	}
+	return ""
+}
+
+// substType returns t with every occurrence of tp replaced by repl. It
+// handles the composite type forms that can appear in an interface
+// method signature; any other form of t (including any we don't
+// recognize) is returned unchanged, which is always safe: at worst the
+// stub signature mentions the type parameter instead of the concrete
+// type, which is still valid Go the user can adjust by hand.
+func substType(t types.Type, tp *types.TypeParam, repl types.Type) types.Type {
+	switch t := t.(type) {
+	case *types.TypeParam:
+		if t == tp {
+			return repl
+		}
+		return t
+	case *types.Pointer:
+		return types.NewPointer(substType(t.Elem(), tp, repl))
+	case *types.Slice:
+		return types.NewSlice(substType(t.Elem(), tp, repl))
+	case *types.Array:
+		return types.NewArray(substType(t.Elem(), tp, repl), t.Len())
+	case *types.Map:
+		return types.NewMap(substType(t.Key(), tp, repl), substType(t.Elem(), tp, repl))
+	case *types.Chan:
+		return types.NewChan(t.Dir(), substType(t.Elem(), tp, repl))
+	case *types.Signature:
+		substTuple := func(tup *types.Tuple) *types.Tuple {
+			if tup == nil {
+				return nil
+			}
+			vars := make([]*types.Var, tup.Len())
+			for i := range vars {
+				v := tup.At(i)
+				vars[i] = types.NewVar(v.Pos(), v.Pkg(), v.Name(), substType(v.Type(), tp, repl))
+			}
+			return types.NewTuple(vars...)
+		}
+		return types.NewSignatureType(nil, nil, nil, substTuple(t.Params()), substTuple(t.Results()), t.Variadic())
+	}
+	return t
+}
+
+// newImport records a package that a stubbed method references but
+// file does not yet import.
+type newImport struct {
+	name string // package's declared name
+	path string
+}
+
+// importQualifier returns a types.Qualifier that renders a referenced
+// package using file's own import list: the local name of an existing
+// import, or the package's declared name otherwise, recording the
+// latter case in *newImports so the caller can splice in the new import
+// afterward.
+func importQualifier(file *ast.File, newImports *[]newImport) types.Qualifier {
+	return func(pkg *types.Package) string {
+		for _, imp := range file.Imports {
+			path := metadataImportPath(imp)
+			if path != pkg.Path() {
+				continue
+			}
+			switch {
+			case imp.Name == nil:
+				return pkg.Name()
+			case imp.Name.Name == "_":
+				continue
+			case imp.Name.Name == ".":
+				return ""
+			default:
+				return imp.Name.Name
+			}
+		}
+		for _, ni := range *newImports {
+			if ni.path == pkg.Path() {
+				return ni.name
+			}
+		}
+		*newImports = append(*newImports, newImport{name: pkg.Name(), path: pkg.Path()})
+		return pkg.Name()
+	}
+}
+
+// metadataImportPath returns the unquoted import path of spec, or "" if
+// it is malformed.
+func metadataImportPath(spec *ast.ImportSpec) string {
+	path := spec.Path.Value
+	if len(path) < 2 {
+		return ""
+	}
+	return path[1 : len(path)-1]
+}
+
+// stubImportName returns the name to pass to astutil.AddNamedImport for
+// imp: empty unless imp's declared package name differs from the import
+// path's last component, in which case an explicit name avoids
+// ambiguity.
+func stubImportName(imp newImport) string {
+	if imp.name == pathpkg.Base(imp.path) {
+		return ""
+	}
+	return imp.name
+}
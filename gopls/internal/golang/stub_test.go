@@ -0,0 +1,196 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/gopls/internal/golang/stubmethods"
+)
+
+// checkFile type-checks src as a standalone file and returns its fset,
+// syntax and type information.
+func checkFile(t *testing.T, src string) (*token.FileSet, *ast.File, *types.Info) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{Importer: importer.Default()}
+	if _, err := conf.Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatalf("type-checking: %v", err)
+	}
+	return fset, file, info
+}
+
+// namedType returns the *types.Named declared by "type name ..." in file.
+func namedType(t *testing.T, file *ast.File, info *types.Info, name string) *types.Named {
+	t.Helper()
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ts.Name.Name == name {
+				return info.Defs[ts.Name].Type().(*types.Named)
+			}
+		}
+	}
+	t.Fatalf("no type named %s", name)
+	return nil
+}
+
+func TestStubMethods(t *testing.T) {
+	const src = `package p
+
+type Writer interface {
+	// Write writes p and returns the number of bytes written.
+	Write(p []byte) (int, error)
+}
+
+type MyWriter struct{}
+`
+	fset, file, info := checkFile(t, src)
+	writer := namedType(t, file, info, "Writer")
+	concrete := namedType(t, file, info, "MyWriter")
+
+	si := &stubmethods.StubInfo{
+		Interface: writer.Obj(),
+		Iface:     writer.Underlying().(*types.Interface),
+		Concrete:  concrete,
+	}
+
+	out, err := StubMethods(fset, file, []byte(src), si)
+	if err != nil {
+		t.Fatalf("StubMethods: %v", err)
+	}
+	got := string(out)
+	if !strings.Contains(got, "func (m MyWriter) Write(p []byte) (int, error)") {
+		t.Errorf("StubMethods output missing stub method signature; got:\n%s", got)
+	}
+	if !strings.Contains(got, `panic("unimplemented")`) {
+		t.Errorf("StubMethods output missing panic body; got:\n%s", got)
+	}
+}
+
+func TestStubMethodsAddsImport(t *testing.T) {
+	// The file does not import io, but the stubbed io.ReaderFrom method
+	// mentions io.Reader, so StubMethods must add the import.
+	const src = `package p
+
+type MyReader struct{}
+`
+	fset, file, info := checkFile(t, src)
+	concrete := namedType(t, file, info, "MyReader")
+	ioPkg, err := importer.Default().Import("io")
+	if err != nil {
+		t.Fatalf("importing io: %v", err)
+	}
+	readerFrom := ioPkg.Scope().Lookup("ReaderFrom").(*types.TypeName)
+
+	si := &stubmethods.StubInfo{
+		Interface: readerFrom,
+		Iface:     readerFrom.Type().Underlying().(*types.Interface),
+		Concrete:  concrete,
+	}
+
+	out, err := StubMethods(fset, file, []byte(src), si)
+	if err != nil {
+		t.Fatalf("StubMethods: %v", err)
+	}
+	got := string(out)
+	if !strings.Contains(got, `import "io"`) {
+		t.Errorf("StubMethods output missing added io import; got:\n%s", got)
+	}
+	if !strings.Contains(got, "func (m MyReader) ReadFrom(r io.Reader) (n int64, err error)") {
+		t.Errorf("StubMethods output missing io.Reader parameter; got:\n%s", got)
+	}
+}
+
+func TestMissingMethods(t *testing.T) {
+	const src = `package p
+
+type Iface interface {
+	A()
+	B()
+}
+
+type Partial struct{}
+
+func (Partial) A() {}
+`
+	_, file, info := checkFile(t, src)
+	iface := namedType(t, file, info, "Iface").Underlying().(*types.Interface)
+	concrete := namedType(t, file, info, "Partial")
+
+	si := &stubmethods.StubInfo{Iface: iface, Concrete: concrete}
+	missing := missingMethods(si)
+	if len(missing) != 1 || missing[0].Name() != "B" {
+		t.Errorf("missingMethods = %v, want [B]", missing)
+	}
+}
+
+func TestStubReceiver(t *testing.T) {
+	for _, test := range []struct{ typeName, want string }{
+		{"MyWriter", "m"},
+		{"T", "t"},
+		{"", "r"},
+	} {
+		if got := stubReceiver(test.typeName); got != test.want {
+			t.Errorf("stubReceiver(%q) = %q, want %q", test.typeName, got, test.want)
+		}
+	}
+}
+
+func TestStubImportName(t *testing.T) {
+	for _, test := range []struct {
+		imp  newImport
+		want string
+	}{
+		{newImport{name: "io", path: "io"}, ""},
+		{newImport{name: "rand", path: "math/rand"}, ""},
+		{newImport{name: "yaml", path: "gopkg.in/yaml.v3"}, "yaml"},
+	} {
+		if got := stubImportName(test.imp); got != test.want {
+			t.Errorf("stubImportName(%+v) = %q, want %q", test.imp, got, test.want)
+		}
+	}
+}
+
+func TestSubstType(t *testing.T) {
+	const src = `package p
+
+func F[T any](s []T, m map[string]T) T { var zero T; return zero }
+`
+	_, file, info := checkFile(t, src)
+	var fn *ast.FuncDecl
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Name.Name == "F" {
+			fn = fd
+		}
+	}
+	tp := info.Defs[fn.Type.TypeParams.List[0].Names[0]].Type().(*types.TypeParam)
+	sig := info.Defs[fn.Name].Type().(*types.Signature)
+
+	got := substType(sig, tp, types.Typ[types.Int])
+	want := "func(s []int, m map[string]int) int"
+	if got.String() != want {
+		t.Errorf("substType = %s, want %s", got, want)
+	}
+}
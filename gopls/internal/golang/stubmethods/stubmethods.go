@@ -20,17 +20,41 @@ import (
 // StubInfo represents a concrete type
 // that wants to stub out an interface type
 type StubInfo struct {
+	Fset *token.FileSet // the FileSet used to type-check the types below
+
 	// Interface is the interface that the client wants to implement.
-	// When the interface is defined, the underlying object will be a TypeName.
-	// Note that we keep track of types.Object instead of types.Type in order
-	// to keep a reference to the declaring object's package and the ast file
-	// in the case where the concrete type file requires a new import that happens to be renamed
-	// in the interface file.
-	// TODO(marwan-at-work): implement interface literals.
-	Fset      *token.FileSet // the FileSet used to type-check the types below
+	// It is set when the target interface is a defined (named) type, in
+	// which case the underlying object is a TypeName. Note that we keep
+	// track of types.Object instead of types.Type in order to keep a
+	// reference to the declaring object's package and the ast file in
+	// the case where the concrete type file requires a new import that
+	// happens to be renamed in the interface file.
+	//
+	// Interface is nil when the target is instead spelled as an
+	// anonymous interface literal (e.g. a func parameter or result
+	// written as interface{ M() }), in which case IfaceNode holds its
+	// syntax when it is reachable from the file enclosing the fix (the
+	// fixer copies method doc comments from it); there is no declaring
+	// package to consult, so the fixer resolves any imports the methods
+	// require against the file enclosing the fix.
 	Interface *types.TypeName
-	Concrete  *types.Named
-	Pointer   bool
+	Iface     *types.Interface
+	IfaceNode *ast.InterfaceType
+
+	// TypeParam is set when Iface was derived not from the interface
+	// spelled at the use site but from the constraint of a generic
+	// function's type parameter (e.g. Do[T io.Reader](t T), called with
+	// a concrete argument that does not satisfy io.Reader). Constraint
+	// methods may mention TypeParam in their signature (for example a
+	// constraint such as interface { CompareTo(T) int }); the fixer
+	// substitutes Concrete (or *Concrete, per Pointer) for TypeParam
+	// when rendering them so that the
+	// stubbed methods reference the concrete instantiation rather than
+	// the type parameter's name.
+	TypeParam *types.TypeParam
+
+	Concrete *types.Named
+	Pointer  bool
 }
 
 // GetStubInfo determines whether the "missing method error"
@@ -61,7 +85,7 @@ func GetStubInfo(fset *token.FileSet, info *types.Info, path []ast.Node, pos tok
 			// because they don't point to a function or method declaration elsewhere.
 			// For eaxmple, "var Interface = (*Concrete)(nil)". In that case, continue
 			// this loop to encounter other possibilities such as *ast.ValueSpec or others.
-			si := fromCallExpr(fset, info, pos, n)
+			si := fromCallExpr(fset, info, pos, path, n)
 			if si != nil {
 				return si
 			}
@@ -73,7 +97,7 @@ func GetStubInfo(fset *token.FileSet, info *types.Info, path []ast.Node, pos tok
 // fromCallExpr tries to find an *ast.CallExpr's function declaration and
 // analyzes a function call's signature against the passed in parameter to deduce
 // the concrete and interface types.
-func fromCallExpr(fset *token.FileSet, info *types.Info, pos token.Pos, call *ast.CallExpr) *StubInfo {
+func fromCallExpr(fset *token.FileSet, info *types.Info, pos token.Pos, path []ast.Node, call *ast.CallExpr) *StubInfo {
 	// Find argument containing pos.
 	argIdx := -1
 	var arg ast.Expr
@@ -96,32 +120,175 @@ func fromCallExpr(fset *token.FileSet, info *types.Info, pos token.Pos, call *as
 	if !ok {
 		return nil
 	}
-	sig, ok := types.Unalias(tv.Type).(*types.Signature)
+	genericSig, ok := types.Unalias(tv.Type).(*types.Signature)
 	if !ok {
 		return nil
 	}
-	var paramType types.Type
-	if sig.Variadic() && argIdx >= sig.Params().Len()-1 {
-		v := sig.Params().At(sig.Params().Len() - 1)
-		if s, _ := v.Type().(*types.Slice); s != nil {
-			paramType = s.Elem()
+	// If call.Fun denotes a (possibly explicitly instantiated) call to a
+	// generic function, prefer the instantiated signature recorded in
+	// info.Instances: it has already substituted the caller's type
+	// arguments for the function's type parameters, so paramType below
+	// reflects what the caller actually passed instead of a bare
+	// *types.TypeParam. But for the common case that motivates
+	// TypeParam in the first place - a call like Do(x) where type
+	// inference substituted x's own (non-interface) type for T - the
+	// instantiated param type is never an interface, so we still need
+	// genericSig's bare type parameter as a fallback below.
+	sig := genericSig
+	if sig.TypeParams().Len() > 0 {
+		if id := calleeIdent(call.Fun); id != nil {
+			if inst, ok := info.Instances[id]; ok {
+				if s, ok := inst.Type.(*types.Signature); ok {
+					sig = s
+				}
+			}
 		}
-	} else if argIdx < sig.Params().Len() {
-		paramType = sig.Params().At(argIdx).Type()
 	}
+	// paramFields holds the syntax of call.Fun's parameter list, if
+	// available: either the *ast.FuncLit being called directly, or the
+	// *ast.FuncDecl of a named function or method declared in the same
+	// file, found by matching the callee identifier's object against the
+	// file's declarations. (A callee declared in another file has no
+	// syntax reachable from path, so paramFields stays nil and the
+	// resulting StubInfo, if any, simply has no IfaceNode.)
+	var paramFields *ast.FieldList
+	if lit, ok := call.Fun.(*ast.FuncLit); ok {
+		paramFields = lit.Type.Params
+	} else if decl := calleeFuncDecl(path, info, call.Fun); decl != nil {
+		paramFields = decl.Type.Params
+	}
+
+	paramType := paramTypeAt(sig, argIdx)
 	if paramType == nil {
 		return nil // A type error prevents us from determining the param type.
 	}
-	iface := ifaceObjFromType(paramType)
+	var paramNode ast.Expr
+	if sig.Variadic() && argIdx >= sig.Params().Len()-1 {
+		paramNode = fieldType(paramFields, sig.Params().Len()-1)
+	} else {
+		paramNode = fieldType(paramFields, argIdx)
+	}
+	if ell, ok := paramNode.(*ast.Ellipsis); ok {
+		paramNode = ell.Elt
+	}
+	tname, iface, tparam := ifaceObjFromType(paramType)
 	if iface == nil {
-		return nil
+		// paramType, from the instantiated signature, is essentially
+		// never itself an interface. Fall back to the generic
+		// signature's parameter - the bare type parameter - so a
+		// constraint such as io.Reader can still be offered.
+		if generic := paramTypeAt(genericSig, argIdx); generic != nil {
+			tname, iface, tparam = ifaceObjFromType(generic)
+		}
+		if iface == nil {
+			return nil
+		}
+	}
+	var ifaceNode *ast.InterfaceType
+	if tname == nil && tparam == nil {
+		if n, ok := paramNode.(*ast.InterfaceType); ok {
+			ifaceNode = n
+		}
 	}
 	return &StubInfo{
 		Fset:      fset,
 		Concrete:  concType,
 		Pointer:   pointer,
-		Interface: iface,
+		Interface: tname,
+		Iface:     iface,
+		IfaceNode: ifaceNode,
+		TypeParam: tparam,
+	}
+}
+
+// calleeIdent returns the identifier under which info.Instances records
+// the instantiation of a (possibly explicitly instantiated) generic
+// function or method call, or nil if fun is not such a reference.
+func calleeIdent(fun ast.Expr) *ast.Ident {
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		return fun
+	case *ast.SelectorExpr:
+		return fun.Sel
+	case *ast.IndexExpr:
+		return calleeIdent(fun.X)
+	case *ast.IndexListExpr:
+		return calleeIdent(fun.X)
+	}
+	return nil
+}
+
+// calleeFuncDecl returns the *ast.FuncDecl of the named function or
+// method that fun (a CallExpr.Fun) refers to, by matching its callee
+// identifier's object against the declarations of the *ast.File found
+// in path. It returns nil if fun is not such a reference, or if the
+// callee is declared in some other file, since path only gives us
+// syntax for the file containing pos.
+func calleeFuncDecl(path []ast.Node, info *types.Info, fun ast.Expr) *ast.FuncDecl {
+	id := calleeIdent(fun)
+	if id == nil {
+		return nil
+	}
+	obj, ok := info.Uses[id]
+	if !ok {
+		return nil
+	}
+	var file *ast.File
+	for _, n := range path {
+		if f, ok := n.(*ast.File); ok {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		return nil
+	}
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && info.Defs[fd.Name] == obj {
+			return fd
+		}
+	}
+	return nil
+}
+
+// paramTypeAt returns the type of sig's i'th parameter as seen by a call
+// site, unwrapping a final variadic parameter's slice type to its
+// element type when i falls within (or past) it. It returns nil if i is
+// out of range, or if the variadic parameter's type isn't a slice
+// (a type error).
+func paramTypeAt(sig *types.Signature, i int) types.Type {
+	n := sig.Params().Len()
+	if sig.Variadic() && i >= n-1 {
+		s, _ := sig.Params().At(n - 1).Type().(*types.Slice)
+		if s == nil {
+			return nil
+		}
+		return s.Elem()
+	}
+	if i < n {
+		return sig.Params().At(i).Type()
 	}
+	return nil
+}
+
+// fieldType returns the type expression of the i'th parameter or result
+// in fields, flattening groups of names declared under one *ast.Field
+// (e.g. "a, b io.Writer"). It returns nil if i is out of range.
+func fieldType(fields *ast.FieldList, i int) ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	for _, f := range fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		if i < n {
+			return f.Type
+		}
+		i -= n
+	}
+	return nil
 }
 
 // fromReturnStmt analyzes a "return" statement to extract
@@ -155,7 +322,7 @@ func fromReturnStmt(fset *token.FileSet, info *types.Info, pos token.Pos, path [
 			len(ret.Results),
 			len(funcType.Results.List))
 	}
-	iface := ifaceType(funcType.Results.List[returnIdx].Type, info)
+	tname, iface, tparam, node := ifaceType(funcType.Results.List[returnIdx].Type, info)
 	if iface == nil {
 		return nil, nil
 	}
@@ -163,7 +330,10 @@ func fromReturnStmt(fset *token.FileSet, info *types.Info, pos token.Pos, path [
 		Fset:      fset,
 		Concrete:  concType,
 		Pointer:   pointer,
-		Interface: iface,
+		Interface: tname,
+		Iface:     iface,
+		IfaceNode: node,
+		TypeParam: tparam,
 	}, nil
 }
 
@@ -183,24 +353,27 @@ func fromValueSpec(fset *token.FileSet, info *types.Info, spec *ast.ValueSpec, p
 	}
 
 	// Possible implicit/explicit conversion to interface type?
-	ifaceNode := spec.Type // var _ myInterface = ...
-	if call, ok := rhs.(*ast.CallExpr); ok && ifaceNode == nil && len(call.Args) == 1 {
+	ifaceExpr := spec.Type // var _ myInterface = ...
+	if call, ok := rhs.(*ast.CallExpr); ok && ifaceExpr == nil && len(call.Args) == 1 {
 		// var _ = myInterface(v)
-		ifaceNode = call.Fun
+		ifaceExpr = call.Fun
 		rhs = call.Args[0]
 	}
 	concType, pointer := concreteType(rhs, info)
 	if concType == nil || concType.Obj().Pkg() == nil {
 		return nil
 	}
-	ifaceObj := ifaceType(ifaceNode, info)
-	if ifaceObj == nil {
+	tname, iface, tparam, node := ifaceType(ifaceExpr, info)
+	if iface == nil {
 		return nil
 	}
 	return &StubInfo{
 		Fset:      fset,
 		Concrete:  concType,
-		Interface: ifaceObj,
+		Interface: tname,
+		Iface:     iface,
+		IfaceNode: node,
+		TypeParam: tparam,
 		Pointer:   pointer,
 	}
 }
@@ -235,8 +408,8 @@ func fromAssignStmt(fset *token.FileSet, info *types.Info, assign *ast.AssignStm
 		return nil
 	}
 
-	ifaceObj := ifaceType(lhs, info)
-	if ifaceObj == nil {
+	tname, iface, tparam, node := ifaceType(lhs, info)
+	if iface == nil {
 		return nil
 	}
 	concType, pointer := concreteType(rhs, info)
@@ -246,35 +419,86 @@ func fromAssignStmt(fset *token.FileSet, info *types.Info, assign *ast.AssignStm
 	return &StubInfo{
 		Fset:      fset,
 		Concrete:  concType,
-		Interface: ifaceObj,
+		Interface: tname,
+		Iface:     iface,
+		IfaceNode: node,
+		TypeParam: tparam,
 		Pointer:   pointer,
 	}
 }
 
-// ifaceType returns the named interface type to which e refers, if any.
-func ifaceType(e ast.Expr, info *types.Info) *types.TypeName {
+// ifaceType returns the interface type to which e refers: either a
+// defined (named) interface type, with tname set to its *types.TypeName,
+// or an anonymous interface literal, with tname nil and node set to its
+// *ast.InterfaceType syntax. tparam is set instead of either when e is a
+// type parameter, in which case iface is the underlying interface of its
+// constraint.
+func ifaceType(e ast.Expr, info *types.Info) (tname *types.TypeName, iface *types.Interface, tparam *types.TypeParam, node *ast.InterfaceType) {
 	tv, ok := info.Types[e]
 	if !ok {
-		return nil
+		return nil, nil, nil, nil
+	}
+	tname, iface, tparam = ifaceObjFromType(tv.Type)
+	if iface == nil {
+		return nil, nil, nil, nil
+	}
+	if tname == nil && tparam == nil {
+		if lit, ok := unparen(e).(*ast.InterfaceType); ok {
+			node = lit
+		}
 	}
-	return ifaceObjFromType(tv.Type)
+	return tname, iface, tparam, node
 }
 
-func ifaceObjFromType(t types.Type) *types.TypeName {
-	named, ok := types.Unalias(t).(*types.Named)
-	if !ok {
-		return nil
-	}
-	if !types.IsInterface(named) {
-		return nil
+// ifaceObjFromType decomposes t into the interface it denotes:
+//   - if t is a defined (named) interface type, it returns its
+//     *types.TypeName along with its underlying *types.Interface.
+//   - if t is itself an (unnamed) interface type, such as an interface
+//     literal, it returns a nil *types.TypeName and t directly.
+//   - if t is a type parameter, it returns the underlying interface of
+//     its constraint and the *types.TypeParam itself, so that callers
+//     can substitute it back out when rendering stubbed methods. A
+//     constraint whose type set does not guarantee any methods (e.g. a
+//     bare union such as interface{ ~int | ~string }) has nothing to
+//     stub, so it is treated as not an interface.
+//
+// It returns all nils if t is not an interface, directly or via a type
+// parameter's constraint, at all.
+func ifaceObjFromType(t types.Type) (*types.TypeName, *types.Interface, *types.TypeParam) {
+	switch t := types.Unalias(t).(type) {
+	case *types.Named:
+		iface, ok := t.Underlying().(*types.Interface)
+		if !ok {
+			return nil, nil, nil
+		}
+		// Interfaces defined in the "builtin" package return nil a Pkg().
+		// But they are still real interfaces that we need to make a special case for.
+		// Therefore, protect gopls from panicking if a new interface type was added in the future.
+		if t.Obj().Pkg() == nil && t.Obj().Name() != "error" {
+			return nil, nil, nil
+		}
+		return t.Obj(), iface, nil
+	case *types.Interface:
+		return nil, t, nil
+	case *types.TypeParam:
+		iface, ok := t.Constraint().Underlying().(*types.Interface)
+		if !ok || iface.NumMethods() == 0 {
+			return nil, nil, nil
+		}
+		return nil, iface, t
 	}
-	// Interfaces defined in the "builtin" package return nil a Pkg().
-	// But they are still real interfaces that we need to make a special case for.
-	// Therefore, protect gopls from panicking if a new interface type was added in the future.
-	if named.Obj().Pkg() == nil && named.Obj().Name() != "error" {
-		return nil
+	return nil, nil, nil
+}
+
+// unparen returns e with any enclosing parentheses stripped.
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
 	}
-	return named.Obj()
 }
 
 // concreteType tries to extract the *types.Named that defines
@@ -294,6 +518,19 @@ func concreteType(e ast.Expr, info *types.Info) (*types.Named, bool) {
 	if isPtr {
 		typ = ptr.Elem()
 	}
+	// e's static type may itself be a type parameter, e.g. a value of
+	// type T inside the body of func Do[T io.Reader](t T). There is
+	// usually no single concrete type to stub in that case, unless the
+	// constraint pins the type set down to exactly one defined type
+	// (e.g. interface { ~MyType }), in which case that is the type the
+	// user presumably meant.
+	if tp, ok := types.Unalias(typ).(*types.TypeParam); ok {
+		named, ok := soleCoreType(tp)
+		if !ok {
+			return nil, false
+		}
+		typ = named
+	}
 	named, ok := types.Unalias(typ).(*types.Named)
 	if !ok {
 		return nil, false
@@ -301,6 +538,32 @@ func concreteType(e ast.Expr, info *types.Info) (*types.Named, bool) {
 	return named, isPtr
 }
 
+// soleCoreType reports whether tp's constraint reduces to exactly one
+// defined (*types.Named) type term, such as interface { ~MyType } or
+// interface { MyType }, and if so returns it.
+func soleCoreType(tp *types.TypeParam) (*types.Named, bool) {
+	iface, ok := tp.Constraint().Underlying().(*types.Interface)
+	if !ok || iface.NumEmbeddeds() != 1 {
+		return nil, false
+	}
+	// A single bare embedded type, e.g. interface { MyType }, is not
+	// wrapped in a *types.Union at all; only a term with a "~" prefix or
+	// more than one term joined by "|" is. Handle both shapes.
+	embedded := iface.EmbeddedType(0)
+	if named, ok := embedded.(*types.Named); ok {
+		return named, true
+	}
+	union, ok := embedded.(*types.Union)
+	if !ok || union.Len() != 1 {
+		return nil, false
+	}
+	named, ok := union.Term(0).Type().(*types.Named)
+	if !ok {
+		return nil, false
+	}
+	return named, true
+}
+
 // enclosingFunction returns the signature and type of the function
 // enclosing the given position.
 func enclosingFunction(path []ast.Node, info *types.Info) *ast.FuncType {
@@ -317,4 +580,4 @@ func enclosingFunction(path []ast.Node, info *types.Info) *ast.FuncType {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,232 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stubmethods
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+// check type-checks src as a standalone file named "p" and returns its
+// syntax and type information.
+func check(t *testing.T, src string) (*ast.File, *types.Info) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Instances: make(map[*ast.Ident]types.Instance),
+	}
+	conf := types.Config{Importer: importer.Default()}
+	if _, err := conf.Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatalf("type-checking: %v", err)
+	}
+	return file, info
+}
+
+// funcDecl returns the *ast.FuncDecl named name in file.
+func funcDecl(file *ast.File, name string) *ast.FuncDecl {
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Name.Name == name {
+			return fd
+		}
+	}
+	return nil
+}
+
+// fileTypeSpecName returns the *ast.Ident naming the type declared by
+// "type name ..." in file.
+func fileTypeSpecName(file *ast.File, name string) *ast.Ident {
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ts.Name.Name == name {
+				return ts.Name
+			}
+		}
+	}
+	return nil
+}
+
+func TestUnparen(t *testing.T) {
+	x := &ast.Ident{Name: "x"}
+	got := unparen(&ast.ParenExpr{X: &ast.ParenExpr{X: x}})
+	if got != ast.Expr(x) {
+		t.Errorf("unparen did not strip nested parens, got %#v", got)
+	}
+	if got := unparen(x); got != ast.Expr(x) {
+		t.Errorf("unparen modified an expression with no parens, got %#v", got)
+	}
+}
+
+func TestFieldType(t *testing.T) {
+	file, _ := check(t, `package p
+func f(a, b int, c string) {}
+`)
+	fields := funcDecl(file, "f").Type.Params
+	for _, test := range []struct {
+		i    int
+		want string // "" means nil
+	}{
+		{0, "int"},
+		{1, "int"},
+		{2, "string"},
+		{3, ""},
+	} {
+		got := fieldType(fields, test.i)
+		if test.want == "" {
+			if got != nil {
+				t.Errorf("fieldType(fields, %d) = %v, want nil", test.i, got)
+			}
+			continue
+		}
+		id, ok := got.(*ast.Ident)
+		if !ok || id.Name != test.want {
+			t.Errorf("fieldType(fields, %d) = %v, want %s", test.i, got, test.want)
+		}
+	}
+}
+
+func TestIfaceObjFromType(t *testing.T) {
+	file, info := check(t, `package p
+
+type Named interface{ M() }
+
+func Anon(w interface{ Write([]byte) (int, error) }) {}
+
+func WithMethod[T interface{ M() }](t T) {}
+
+func NoMethods[T interface{ ~int | ~string }](t T) {}
+`)
+
+	// Named interface: tname and iface set, tparam nil.
+	nt := info.Defs[fileTypeSpecName(file, "Named")]
+	tname, iface, tparam := ifaceObjFromType(nt.Type())
+	if tname == nil || iface == nil || tparam != nil {
+		t.Errorf("ifaceObjFromType(Named) = (%v, %v, %v), want (non-nil, non-nil, nil)", tname, iface, tparam)
+	}
+
+	// Anonymous interface literal: tname nil, iface set.
+	anonParam := funcDecl(file, "Anon").Type.Params.List[0].Type
+	tname, iface, tparam = ifaceObjFromType(info.Types[anonParam].Type)
+	if tname != nil || iface == nil || tparam != nil {
+		t.Errorf("ifaceObjFromType(anon) = (%v, %v, %v), want (nil, non-nil, nil)", tname, iface, tparam)
+	}
+
+	// Type parameter whose constraint has a method: tparam set.
+	tpIdent := funcDecl(file, "WithMethod").Type.TypeParams.List[0].Names[0]
+	tname, iface, tparam = ifaceObjFromType(info.Defs[tpIdent].Type())
+	if tname != nil || iface == nil || tparam == nil {
+		t.Errorf("ifaceObjFromType(WithMethod's T) = (%v, %v, %v), want (nil, non-nil, non-nil)", tname, iface, tparam)
+	}
+
+	// Type parameter whose constraint is a bare union with no common
+	// methods: nothing to stub, so all nils.
+	tpIdent = funcDecl(file, "NoMethods").Type.TypeParams.List[0].Names[0]
+	tname, iface, tparam = ifaceObjFromType(info.Defs[tpIdent].Type())
+	if tname != nil || iface != nil || tparam != nil {
+		t.Errorf("ifaceObjFromType(NoMethods's T) = (%v, %v, %v), want (nil, nil, nil)", tname, iface, tparam)
+	}
+}
+
+func TestParamTypeAt(t *testing.T) {
+	file, info := check(t, `package p
+func f(a int, b ...string) {}
+func g(a int) {}
+`)
+	sig := info.Defs[funcDecl(file, "f").Name].Type().(*types.Signature)
+	for _, test := range []struct {
+		i    int
+		want string // types.TypeString, or "" for nil
+	}{
+		{0, "int"},
+		{1, "string"}, // variadic param unwrapped to its element type
+		{5, "string"}, // further variadic args still unwrap to the element type
+	} {
+		got := paramTypeAt(sig, test.i)
+		if test.want == "" {
+			if got != nil {
+				t.Errorf("paramTypeAt(sig, %d) = %v, want nil", test.i, got)
+			}
+			continue
+		}
+		if got == nil || got.String() != test.want {
+			t.Errorf("paramTypeAt(sig, %d) = %v, want %s", test.i, got, test.want)
+		}
+	}
+
+	// A non-variadic signature has no fallback for an out-of-range index.
+	nonVariadic := info.Defs[funcDecl(file, "g").Name].Type().(*types.Signature)
+	if got := paramTypeAt(nonVariadic, 5); got != nil {
+		t.Errorf("paramTypeAt out of range = %v, want nil", got)
+	}
+}
+
+func TestSoleCoreType(t *testing.T) {
+	file, info := check(t, `package p
+
+type MyType struct{}
+
+func Sole[T interface{ MyType }](t T) {}
+
+func NotSole[T interface{ ~int | ~string }](t T) {}
+`)
+
+	tpIdent := funcDecl(file, "Sole").Type.TypeParams.List[0].Names[0]
+	tp := info.Defs[tpIdent].Type().(*types.TypeParam)
+	named, ok := soleCoreType(tp)
+	if !ok || named.Obj().Name() != "MyType" {
+		t.Errorf("soleCoreType(Sole's T) = (%v, %v), want (MyType, true)", named, ok)
+	}
+
+	tpIdent = funcDecl(file, "NotSole").Type.TypeParams.List[0].Names[0]
+	tp = info.Defs[tpIdent].Type().(*types.TypeParam)
+	if _, ok := soleCoreType(tp); ok {
+		t.Errorf("soleCoreType(NotSole's T) = (_, true), want false for a multi-term union")
+	}
+}
+
+func TestCalleeIdent(t *testing.T) {
+	file, _ := check(t, `package p
+
+type T struct{}
+
+func (T) M() {}
+
+func F[X any](x X) {}
+
+func g() {
+	var t T
+	t.M()
+	F(1)
+	F[int](1)
+}
+`)
+	g := funcDecl(file, "g")
+	for _, stmt := range g.Body.List {
+		es, ok := stmt.(*ast.ExprStmt)
+		if !ok {
+			continue
+		}
+		call := es.X.(*ast.CallExpr)
+		id := calleeIdent(call.Fun)
+		if id == nil {
+			t.Errorf("calleeIdent(%v) = nil", call.Fun)
+		}
+	}
+}